@@ -0,0 +1,53 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"time"
+
+	expirable "github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// DefaultEipCacheSize bounds the number of PodIP -> event entries kept per
+// shard. Without a bound the cache grows forever because deleted pods are
+// never evicted from a plain map.
+const DefaultEipCacheSize = 10000
+
+// DefaultEipCacheTTL is how long an entry is trusted before it is evicted
+// even if no delete event ever arrives for it.
+const DefaultEipCacheTTL = 30 * time.Minute
+
+// eipCache is a bounded, TTL'd PodIP -> event cache, one per shard. It
+// replaces the unbounded map[string]event that used to live on Handler.
+type eipCache struct {
+	lru *expirable.LRU[string, event]
+}
+
+func newEipCache(size int, ttl time.Duration) *eipCache {
+	if size <= 0 {
+		size = DefaultEipCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultEipCacheTTL
+	}
+	return &eipCache{lru: expirable.NewLRU[string, event](size, nil, ttl)}
+}
+
+func (c *eipCache) get(podIP string) (event, bool) {
+	return c.lru.Get(podIP)
+}
+
+func (c *eipCache) set(podIP string, e event) {
+	c.lru.Add(podIP, e)
+}
+
+func (c *eipCache) remove(podIP string) {
+	c.lru.Remove(podIP)
+}
+
+// keys returns the PodIPs currently cached, used by the reconciler to detect
+// EIPs in AWS that no longer correspond to anything the controller tracks.
+func (c *eipCache) keys() []string {
+	return c.lru.Keys()
+}
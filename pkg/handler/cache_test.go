@@ -0,0 +1,69 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEipCacheGetSetRemove(t *testing.T) {
+	c := newEipCache(10, time.Minute)
+	e := event{PodIP: "10.0.0.5", ResourceVersion: "1"}
+
+	if _, ok := c.get(e.PodIP); ok {
+		t.Fatal("get on empty cache returned ok=true")
+	}
+
+	c.set(e.PodIP, e)
+	got, ok := c.get(e.PodIP)
+	if !ok {
+		t.Fatal("get after set returned ok=false")
+	}
+	if got.ResourceVersion != e.ResourceVersion {
+		t.Errorf("get = %+v, want %+v", got, e)
+	}
+
+	c.remove(e.PodIP)
+	if _, ok := c.get(e.PodIP); ok {
+		t.Fatal("get after remove returned ok=true")
+	}
+}
+
+func TestEipCacheKeysReflectsTrackedPods(t *testing.T) {
+	c := newEipCache(10, time.Minute)
+	c.set("10.0.0.5", event{PodIP: "10.0.0.5"})
+	c.set("10.0.0.6", event{PodIP: "10.0.0.6"})
+
+	keys := c.keys()
+	if len(keys) != 2 {
+		t.Fatalf("keys() = %v, want 2 entries", keys)
+	}
+}
+
+func TestEipCacheEvictsAfterTTL(t *testing.T) {
+	c := newEipCache(10, 10*time.Millisecond)
+	c.set("10.0.0.5", event{PodIP: "10.0.0.5"})
+
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := c.get("10.0.0.5"); ok {
+		t.Fatal("entry still present after its TTL elapsed")
+	}
+}
+
+func TestEipCacheDefaultsSizeAndTTL(t *testing.T) {
+	c := newEipCache(0, 0)
+	if c.lru == nil {
+		t.Fatal("newEipCache(0, 0) returned a cache with no LRU")
+	}
+	for i := 0; i <= DefaultEipCacheSize; i++ {
+		ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		c.set(ip, event{PodIP: ip})
+	}
+	if got := c.lru.Len(); got != DefaultEipCacheSize {
+		t.Fatalf("newEipCache(0, 0) holds %d entries after %d inserts, want DefaultEipCacheSize (%d)", got, DefaultEipCacheSize+1, DefaultEipCacheSize)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg/service"
+	"github.com/sirupsen/logrus"
+)
+
+// event is the unit of work queued for a shard: the desired EIP/Shield state
+// for a single pod IP, derived from a single watch notification. Handler
+// caches the most recently processed event per PodIP (see eipCache) so a
+// later event can tell what, if anything, changed since Process last ran.
+type event struct {
+	PodIP           string
+	Family          string
+	ResourceVersion string
+	Action          string
+	AttachIP        bool
+	ShiedAdv        bool
+
+	// AllocationID is the Elastic IP allocation ID backing this pod's
+	// association, set by associate() (or recovered when seeding the cache
+	// from AWS). A later event for the same pod whose desired association is
+	// unchanged reuses it instead of calling AllocateAndAssociate again.
+	// Always empty for Family "ipv6", which has no separate EIP allocation.
+	AllocationID string
+
+	// protectionID is the Shield Advanced protection ID returned when this
+	// event added protection, so a later event that turns protection off
+	// knows which protection to remove. It is set by Process (or recovered
+	// from Shield Advanced when seeding the cache from AWS) and persisted
+	// through the cache entry Handler.process writes on success.
+	protectionID string
+}
+
+// Process reconciles AWS state to match the event: allocating/associating or
+// releasing an Elastic IP, and adding/removing Shield Advanced protection.
+// prev is the previously processed event for this PodIP, or nil the first
+// time the controller sees it; it tells Process whether Shield protection
+// state actually changed and, if so, recovers the protection ID to remove.
+func (e *event) Process(prev *event, ec2Svc *service.EC2Service, shieldSvc *service.ShiedService) error {
+	if e.Action == "delete" || !e.AttachIP {
+		return e.release(prev, ec2Svc, shieldSvc)
+	}
+	return e.associate(prev, ec2Svc, shieldSvc)
+}
+
+func (e *event) associate(prev *event, ec2Svc *service.EC2Service, shieldSvc *service.ShiedService) error {
+	// An already-attached pod whose family hasn't changed already has the
+	// association it wants; re-running AllocateAndAssociate/AssociateIPv6ForPod
+	// here would allocate and attach a second Elastic IP on every benign
+	// update (a Shield-annotation toggle, a status change) without ever
+	// releasing the first one. Only the Shield add/remove branch below still
+	// needs to run for those updates.
+	unchanged := prev != nil && prev.AttachIP && prev.Family == e.Family
+	allocationID := ""
+	if unchanged {
+		allocationID = prev.AllocationID
+	} else {
+		var err error
+		opStart := time.Now()
+		switch e.Family {
+		case "ipv6":
+			err = ec2Svc.AssociateIPv6ForPod(e.PodIP)
+			observeAWSCall("associate_ipv6", &err)(opStart)
+		default:
+			allocationID, err = ec2Svc.AllocateAndAssociate(e.PodIP)
+			observeAWSCall("allocate_and_associate", &err)(opStart)
+		}
+		if err != nil {
+			return fmt.Errorf("associate eip for pod %s: %w", e.PodIP, err)
+		}
+	}
+	e.AllocationID = allocationID
+
+	wasProtected := prev != nil && prev.ShiedAdv
+	switch {
+	case e.ShiedAdv && !wasProtected:
+		if allocationID == "" {
+			logrus.WithField("pod_ip", e.PodIP).Warn("shield advanced requested for an ipv6 pod address, which has no Elastic IP allocation to protect; skipping")
+			break
+		}
+		opStart := time.Now()
+		protectionID, err := shieldSvc.AddProtection(allocationID)
+		observeAWSCall("shield_add_protection", &err)(opStart)
+		if err != nil {
+			return fmt.Errorf("add shield protection for pod %s: %w", e.PodIP, err)
+		}
+		e.protectionID = protectionID
+	case e.ShiedAdv && wasProtected:
+		e.protectionID = prev.protectionID
+	case !e.ShiedAdv && wasProtected && prev.protectionID != "":
+		opStart := time.Now()
+		err := shieldSvc.RemoveProtection(prev.protectionID)
+		observeAWSCall("shield_remove_protection", &err)(opStart)
+		if err != nil {
+			return fmt.Errorf("remove shield protection for pod %s: %w", e.PodIP, err)
+		}
+	}
+	return nil
+}
+
+func (e *event) release(prev *event, ec2Svc *service.EC2Service, shieldSvc *service.ShiedService) error {
+	if prev != nil && prev.ShiedAdv && prev.protectionID != "" {
+		opStart := time.Now()
+		err := shieldSvc.RemoveProtection(prev.protectionID)
+		observeAWSCall("shield_remove_protection", &err)(opStart)
+		if err != nil {
+			return fmt.Errorf("remove shield protection for pod %s: %w", e.PodIP, err)
+		}
+	}
+	if e.Family == "ipv6" {
+		// BYOIP IPv6 addresses are assigned directly onto the ENI rather than
+		// allocated as a separate EIP, so there is nothing left to release
+		// here beyond the Shield protection already removed above.
+		return nil
+	}
+	opStart := time.Now()
+	err := ec2Svc.ReleaseAddressForPod(e.PodIP)
+	observeAWSCall("release_address_for_pod", &err)(opStart)
+	if err != nil {
+		return fmt.Errorf("release eip for pod %s: %w", e.PodIP, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// nestedPodIPs reads a status.podIPs-shaped field. In the real Kubernetes
+// API this is []PodIP, i.e. a list of {"ip": "10.0.0.1"} objects rather than
+// bare strings, so unstructured.NestedStringSlice's per-element type
+// assertion to string fails for every populated pod. Decode it as a generic
+// slice instead and pull the "ip" key out of each entry.
+func nestedPodIPs(obj map[string]interface{}, fields ...string) ([]string, error) {
+	raw, found, err := unstructured.NestedSlice(obj, fields...)
+	if err != nil || !found {
+		return nil, err
+	}
+	ips := make([]string, 0, len(raw))
+	for _, entry := range raw {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ip, ok := m["ip"].(string); ok && ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// podControllerFamilyAnnotation selects which IP family of a dual-stack pod
+// the controller should manage. Valid values are "ipv4" (default), "ipv6"
+// and "dual". "dual" still manages a single address per pod (IPv4 when the
+// pod has one, otherwise IPv6; see selectPodIP), not both.
+const podControllerFamilyAnnotation = "service.beta.kubernetes.io/aws-eip-pod-controller-family"
+
+// selectPodIP picks the address to manage out of a pod's status.podIPs for
+// the requested family. An empty family defaults to "ipv4" to match the
+// controller's historical single-stack behavior. "dual" returns the first
+// address of either family, preferring IPv4, since most of the processing
+// pipeline still tracks one address per pod.
+func selectPodIP(podIPs []string, family string) (string, error) {
+	if family == "" {
+		family = "ipv4"
+	}
+	var v4, v6 string
+	for _, ip := range podIPs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		if parsed.To4() != nil {
+			if v4 == "" {
+				v4 = ip
+			}
+		} else if v6 == "" {
+			v6 = ip
+		}
+	}
+	switch family {
+	case "ipv4":
+		if v4 == "" {
+			return "", fmt.Errorf("no ipv4 address in podIPs %v", podIPs)
+		}
+		return v4, nil
+	case "ipv6":
+		if v6 == "" {
+			return "", fmt.Errorf("no ipv6 address in podIPs %v", podIPs)
+		}
+		return v6, nil
+	case "dual":
+		if v4 != "" {
+			return v4, nil
+		}
+		if v6 != "" {
+			return v6, nil
+		}
+		return "", fmt.Errorf("no address in podIPs %v", podIPs)
+	default:
+		return "", fmt.Errorf("unknown pod controller family %q", family)
+	}
+}
+
+// familyOfIP reports which family ip actually belongs to, for callers that
+// fell back to an address that doesn't necessarily match the family they
+// asked for (see HandleEvent's status.podIP fallback). It returns "" for an
+// unparseable address.
+func familyOfIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// hashPodIP is the family-agnostic shard hash for a pod IP. It hashes the
+// raw address bytes with FNV-64a (falling back to the string form for
+// anything net.ParseIP rejects) so IPv4 and IPv6 addresses shard the same
+// way.
+func hashPodIP(podIP string) uint64 {
+	h := fnv.New64a()
+	if parsed := net.ParseIP(podIP); parsed != nil {
+		_, _ = h.Write(parsed)
+	} else {
+		_, _ = h.Write([]byte(podIP))
+	}
+	return h.Sum64()
+}
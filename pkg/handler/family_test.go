@@ -0,0 +1,112 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import "testing"
+
+func TestSelectPodIP(t *testing.T) {
+	podIPs := []string{"10.0.0.5", "2001:db8::5"}
+
+	tests := []struct {
+		name    string
+		family  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default family is ipv4", family: "", want: "10.0.0.5"},
+		{name: "explicit ipv4", family: "ipv4", want: "10.0.0.5"},
+		{name: "explicit ipv6", family: "ipv6", want: "2001:db8::5"},
+		{name: "dual prefers ipv4", family: "dual", want: "10.0.0.5"},
+		{name: "unknown family errors", family: "bogus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectPodIP(podIPs, tt.family)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("selectPodIP(%v, %q) = %q, nil; want error", podIPs, tt.family, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectPodIP(%v, %q) returned error: %v", podIPs, tt.family, err)
+			}
+			if got != tt.want {
+				t.Errorf("selectPodIP(%v, %q) = %q, want %q", podIPs, tt.family, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectPodIPNoMatchingFamily(t *testing.T) {
+	if _, err := selectPodIP([]string{"10.0.0.5"}, "ipv6"); err == nil {
+		t.Fatal("selectPodIP with no ipv6 address in podIPs: want error, got nil")
+	}
+}
+
+func TestNestedPodIPsDecodesIPObjects(t *testing.T) {
+	obj := map[string]interface{}{
+		"status": map[string]interface{}{
+			"podIPs": []interface{}{
+				map[string]interface{}{"ip": "10.0.0.5"},
+				map[string]interface{}{"ip": "2001:db8::5"},
+			},
+		},
+	}
+
+	ips, err := nestedPodIPs(obj, "status", "podIPs")
+	if err != nil {
+		t.Fatalf("nestedPodIPs returned error: %v", err)
+	}
+	want := []string{"10.0.0.5", "2001:db8::5"}
+	if len(ips) != len(want) {
+		t.Fatalf("nestedPodIPs = %v, want %v", ips, want)
+	}
+	for i := range want {
+		if ips[i] != want[i] {
+			t.Errorf("nestedPodIPs[%d] = %q, want %q", i, ips[i], want[i])
+		}
+	}
+}
+
+func TestNestedPodIPsMissingField(t *testing.T) {
+	obj := map[string]interface{}{"status": map[string]interface{}{}}
+	ips, err := nestedPodIPs(obj, "status", "podIPs")
+	if err != nil {
+		t.Fatalf("nestedPodIPs returned error: %v", err)
+	}
+	if len(ips) != 0 {
+		t.Errorf("nestedPodIPs = %v, want empty", ips)
+	}
+}
+
+func TestFamilyOfIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.0.0.5", want: "ipv4"},
+		{ip: "2001:db8::5", want: "ipv6"},
+		{ip: "not-an-ip", want: ""},
+	}
+	for _, tt := range tests {
+		if got := familyOfIP(tt.ip); got != tt.want {
+			t.Errorf("familyOfIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestHashPodIPIsConsistentAndFamilyAgnostic(t *testing.T) {
+	if hashPodIP("10.0.0.5") != hashPodIP("10.0.0.5") {
+		t.Error("hashPodIP is not deterministic for the same input")
+	}
+	if hashPodIP("10.0.0.5") == hashPodIP("10.0.0.6") {
+		t.Error("hashPodIP produced the same hash for two different IPv4 addresses")
+	}
+	// Must not panic or collide trivially for IPv6 input.
+	if hashPodIP("2001:db8::5") == 0 {
+		t.Error("hashPodIP returned zero for an ipv6 address")
+	}
+}
@@ -4,64 +4,231 @@
 package handler
 
 import (
+	"context"
+	"fmt"
 	"io"
-	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws-samples/aws-pod-eip-controller/pkg/service"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/sirupsen/logrus"
-	"github.com/tidwall/gjson"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/workqueue"
 )
 
+// DefaultMetricsAddr is the address the health/readiness/metrics server
+// listens on when Handler.MetricsAddr is left empty.
+const DefaultMetricsAddr = ":8080"
+
 type Handler struct {
-	ChannelSize    int32
-	EC2Service     *service.EC2Service
-	ShiedService   *service.ShiedService
-	ProcessChannel []chan event
-	EipStatusMap   []map[string]event
+	ChannelSize       int32
+	MetricsAddr       string
+	EipCacheSize      int
+	EipCacheTTL       time.Duration
+	ReconcileInterval time.Duration
+	EC2Service        *service.EC2Service
+	ShiedService      *service.ShiedService
+	Queues            []workqueue.RateLimitingInterface
+	EipStatusMap      []*eipCache
+	pending           []*pendingEvents
+	metrics           *metricsServer
+	stopCh            chan struct{}
+	wg                sync.WaitGroup
+}
+
+// startMetrics brings up the health/readiness/metrics HTTP server. It runs
+// regardless of leadership so that a standby replica still serves /healthz
+// and its /readyz still reflects EC2/Shield reachability even while it is
+// not processing events.
+func (h *Handler) startMetrics() {
+	if h.MetricsAddr == "" {
+		h.MetricsAddr = DefaultMetricsAddr
+	}
+	h.metrics = newMetricsServer(h.MetricsAddr)
+	h.metrics.start()
+	go h.refreshReadiness()
+}
+
+// refreshReadiness periodically re-checks that the controller can actually
+// reach the EC2 and Shield Advanced APIs and keeps /readyz in sync with the
+// result, instead of latching ready=true once at startup and never
+// reconsidering it even after one of the AWS clients starts failing every
+// call.
+func (h *Handler) refreshReadiness() {
+	ticker := time.NewTicker(DefaultReadinessCheckInterval)
+	defer ticker.Stop()
+	for {
+		ec2Err := h.EC2Service.Ping()
+		if ec2Err != nil {
+			logrus.WithError(ec2Err).Warn("readiness check failed: ec2")
+		}
+		shieldErr := h.ShiedService.Ping()
+		if shieldErr != nil {
+			logrus.WithError(shieldErr).Warn("readiness check failed: shield")
+		}
+		h.metrics.markReady(ec2Err == nil && shieldErr == nil)
+		<-ticker.C
+	}
 }
 
+// init starts the per-shard workqueues, caches and goroutines. With leader
+// election enabled (see Run in leaderelection.go) it is only called once
+// this replica becomes leader, so only one replica is ever allocating or
+// associating EIPs at a time. Every (re-)election rebuilds the caches from
+// scratch, so they are seeded from AWS before any reconciler goroutine can
+// run: otherwise a replica re-acquiring the lease after a lease flap would
+// start with empty caches and its first reconcile tick would mistake every
+// currently-attached Elastic IP for an orphan.
 func (h *Handler) init() {
-	h.ProcessChannel = make([]chan event, h.ChannelSize)
+	h.stopCh = make(chan struct{})
+	h.Queues = make([]workqueue.RateLimitingInterface, h.ChannelSize)
+	h.pending = make([]*pendingEvents, h.ChannelSize)
+	h.EipStatusMap = make([]*eipCache, h.ChannelSize)
 	for i := 0; i < int(h.ChannelSize); i++ {
-		h.ProcessChannel[i] = make(chan event, 100)
+		h.Queues[i] = newShardQueue(i)
+		h.pending[i] = newPendingEvents()
+		h.EipStatusMap[i] = newEipCache(h.EipCacheSize, h.EipCacheTTL)
 	}
-	h.EipStatusMap = make([]map[string]event, h.ChannelSize)
+	h.seedEipCaches()
 	for i := 0; i < int(h.ChannelSize); i++ {
-		h.EipStatusMap[i] = make(map[string]event)
-		go h.process(i)
+		h.wg.Add(2)
+		go func(i int) {
+			defer h.wg.Done()
+			h.process(i)
+		}(i)
+		go func(i int) {
+			defer h.wg.Done()
+			h.reconcile(i)
+		}(i)
+	}
+}
+
+// seedEipCaches rehydrates every shard's cache from the Elastic IPs this
+// controller has already tagged in the VPC. Without this, a freshly
+// (re-)elected leader's cache starts empty and stays that way until a watch
+// event happens to touch each pod again, which can be longer than one
+// ReconcileInterval — and in the meantime associate() would see every one of
+// those pods as un-attached and allocate a second Elastic IP for each on its
+// next update. ListControllerTaggedAddresses only ever returns IPv4
+// allocations (BYOIP IPv6 addresses are assigned directly onto an ENI, not
+// allocated separately), so every seeded entry is family "ipv4". Shield
+// protection is also recovered here rather than left unset, so a later event
+// that turns protection off targets the real protection ID instead of a
+// stale/empty one.
+func (h *Handler) seedEipCaches() {
+	tagged, err := h.EC2Service.ListControllerTaggedAddresses()
+	if err != nil {
+		logrus.WithError(err).Warn("init: seed eip caches from tagged addresses")
+		return
+	}
+	for _, addr := range tagged {
+		if addr.PodIP == "" {
+			continue
+		}
+		e := event{PodIP: addr.PodIP, Family: "ipv4", AttachIP: true, AllocationID: addr.AllocationID}
+		protectionID, err := h.ShiedService.ProtectionIDForAllocation(addr.AllocationID)
+		if err != nil {
+			logrus.WithError(err).WithField("pod_ip", addr.PodIP).Warn("init: recover shield protection id while seeding eip cache")
+		} else if protectionID != "" {
+			e.ShiedAdv = true
+			e.protectionID = protectionID
+		}
+		shard := hashPodIP(addr.PodIP) % uint64(h.ChannelSize)
+		h.EipStatusMap[shard].set(addr.PodIP, e)
 	}
 }
 
+// process runs the reconcile loop for shard i: pull a PodIP off the
+// workqueue, look up the latest coalesced event for it and process it,
+// re-queuing with backoff on failure instead of dropping the event.
 func (h *Handler) process(i int) {
-	var e event
-	for e = range h.ProcessChannel[i] {
+	shard := strconv.Itoa(i)
+	h.metrics.shardStarted()
+	defer h.metrics.shardStopped()
+
+	for {
+		key, shutdown := h.Queues[i].Get()
+		if shutdown {
+			return
+		}
+		queueDepth.WithLabelValues(shard).Set(float64(h.Queues[i].Len()))
+		podIP := key.(string)
+
+		e, ok := h.pending[i].get(podIP)
+		if !ok {
+			// Already handled by a coalesced run for this key.
+			h.Queues[i].Done(key)
+			h.Queues[i].Forget(key)
+			continue
+		}
+
 		logrus.WithFields(logrus.Fields{
 			"event": e,
 		}).Info("process event")
-		val, ok := h.EipStatusMap[i][e.PodIP]
-		if ok && val.ResourceVersion == e.ResourceVersion {
+
+		val, cached := h.EipStatusMap[i].get(e.PodIP)
+		if cached && val.ResourceVersion == e.ResourceVersion {
 			logrus.Info("same resource version")
+			h.pending[i].deleteIfSame(podIP, e)
+			h.Queues[i].Done(key)
+			h.Queues[i].Forget(key)
 			continue
 		}
-		if !ok {
-			err := e.Process(nil, h.EC2Service, h.ShiedService)
-			if err != nil {
-				logrus.Error(err)
-				continue
-			}
+
+		var err error
+		if !cached {
+			err = e.Process(nil, h.EC2Service, h.ShiedService)
 		} else {
-			e.Process(&val, h.EC2Service, h.ShiedService)
+			err = e.Process(&val, h.EC2Service, h.ShiedService)
 		}
-		h.EipStatusMap[i][e.PodIP] = e
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+
+		eipAction := "associate"
+		if e.Action == "delete" || !e.AttachIP {
+			eipAction = "release"
+		}
+		eipAllocationsTotal.WithLabelValues(eipAction, outcome).Inc()
+
+		shieldWasOn := cached && val.ShiedAdv
+		if e.ShiedAdv && !shieldWasOn {
+			shieldProtectionsTotal.WithLabelValues("add", outcome).Inc()
+		} else if !e.ShiedAdv && shieldWasOn {
+			shieldProtectionsTotal.WithLabelValues("remove", outcome).Inc()
+		}
+
+		if err != nil {
+			logrus.Error(err)
+			eventsProcessedTotal.WithLabelValues(shard, e.Action, "error").Inc()
+			queueRetriesTotal.WithLabelValues(shard).Inc()
+			h.Queues[i].Done(key)
+			h.Queues[i].AddRateLimited(key)
+			continue
+		}
+
+		eventsProcessedTotal.WithLabelValues(shard, e.Action, "success").Inc()
+		if e.Action == "delete" {
+			h.EipStatusMap[i].remove(e.PodIP)
+		} else {
+			h.EipStatusMap[i].set(e.PodIP, e)
+		}
+		h.pending[i].deleteIfSame(podIP, e)
+		h.Queues[i].Done(key)
+		h.Queues[i].Forget(key)
 	}
 }
 
 func (h *Handler) insert2Queue(event event) {
-	hash := int32(event.PodIP2Int()) % h.ChannelSize
-	h.ProcessChannel[hash] <- event
+	hash := int32(hashPodIP(event.PodIP) % uint64(h.ChannelSize))
+	h.pending[hash].set(event.PodIP, event)
+	h.Queues[hash].Add(event.PodIP)
+	queueDepth.WithLabelValues(strconv.Itoa(int(hash))).Set(float64(h.Queues[hash].Len()))
 	logrus.WithFields(logrus.Fields{
 		"event": event,
 		"has":   hash,
@@ -77,6 +244,10 @@ func (h *Handler) HandleEvent(obj *unstructured.Unstructured, oldObj *unstructur
 		logrus.Info("phase: ", phase)
 		return
 	}
+	podIPs, err := nestedPodIPs(obj.Object, "status", "podIPs")
+	if err != nil {
+		return
+	}
 	podIP, exist, err := unstructured.NestedString(obj.Object, "status", "podIP")
 	if err != nil {
 		return
@@ -85,18 +256,45 @@ func (h *Handler) HandleEvent(obj *unstructured.Unstructured, oldObj *unstructur
 		logrus.Info("podIP is empty")
 		return
 	}
+	if len(podIPs) == 0 && len(podIP) > 0 {
+		podIPs = []string{podIP}
+	}
+
+	family := obj.GetAnnotations()[podControllerFamilyAnnotation]
+	selectedIP, err := selectPodIP(podIPs, family)
+	eventFamily := family
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"name":     obj.GetName(),
+			"podIPs":   podIPs,
+			"family":   family,
+			"fallback": podIP,
+		}).Warn("could not select pod IP for requested family, falling back to status.podIP")
+		selectedIP = podIP
+		// status.podIP isn't guaranteed to be the requested family (e.g. the
+		// annotation asked for "ipv6" but the pod only has an IPv4 address),
+		// so re-derive the family from the address we're actually using
+		// instead of carrying the stale annotation value forward: associate/
+		// release pick their AWS code path off event.Family.
+		eventFamily = familyOfIP(selectedIP)
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"name":             obj.GetName(),
 		"uid":              obj.GetUID(),
 		"resource_version": obj.GetResourceVersion(),
 		"annotions":        obj.GetAnnotations(),
 		"phase":            phase,
-		"podIP":            podIP,
+		"podIP":            selectedIP,
+		"podIPs":           podIPs,
+		"family":           family,
 		"action":           action,
 	}).Info()
 	event := event{
-		PodIP:           podIP,
+		PodIP:           selectedIP,
+		Family:          eventFamily,
 		ResourceVersion: obj.GetResourceVersion(),
+		Action:          action,
 		AttachIP:        false,
 		ShiedAdv:        false,
 	}
@@ -128,6 +326,9 @@ func (h *Handler) HandleEvent(obj *unstructured.Unstructured, oldObj *unstructur
 	return
 }
 
+// NewHandler constructs a Handler and its EC2/Shield clients but does not
+// start any shard goroutines. Call Run to start processing events, either
+// immediately or gated behind leader election depending on cfg.Enabled.
 func NewHandler(channelSize int32, vpcid string, region string) (handler *Handler, err error) {
 	if len(vpcid) == 0 || len(region) == 0 {
 		vpcid, region, err = getInfo()
@@ -148,57 +349,81 @@ func NewHandler(channelSize int32, vpcid string, region string) (handler *Handle
 		EC2Service:   ec2Service,
 		ShiedService: shieldService,
 	}
-	handler.init()
+	handler.startMetrics()
 	return handler, nil
 }
 
+// getInfo discovers the VPC and region the controller is running in. It
+// prefers IMDSv2 and falls back to environment/downward-API discovery for
+// platforms such as Fargate where IMDS is unreachable or blocked outright.
 func getInfo() (vpcid string, region string, err error) {
-	// get vpcid from instance meta url
-	url := "http://instance-data/latest/meta-data/network/interfaces/macs/"
-	client := &http.Client{
-		Timeout: time.Second * 5,
+	vpcid, region, err = getInfoFromIMDS()
+	if err == nil {
+		return vpcid, region, nil
 	}
-	res, err := client.Get(url)
+	logrus.WithError(err).Warn("imds lookup failed, falling back to environment discovery")
+	return getInfoFromEnv()
+}
+
+// getInfoFromIMDS fetches the VPC ID and region via IMDSv2. imds.Client
+// handles the session-token handshake (PUT /latest/api/token with a
+// X-aws-ec2-metadata-token-ttl-seconds TTL, then X-aws-ec2-metadata-token on
+// every GET) and non-2xx status codes itself, so IMDSv1-only assumptions and
+// the token dance don't need to be reimplemented here.
+func getInfoFromIMDS() (vpcid string, region string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := imds.New(imds.Options{})
+
+	regionOut, err := client.GetRegion(ctx, &imds.GetRegionInput{})
 	if err != nil {
-		return
+		return "", "", fmt.Errorf("imds get region: %w", err)
 	}
-	macs, err := io.ReadAll(res.Body)
+	region = regionOut.Region
+
+	macsOut, err := client.GetMetadata(ctx, &imds.GetMetadataInput{Path: "network/interfaces/macs/"})
 	if err != nil {
-		return
+		return "", "", fmt.Errorf("imds list macs: %w", err)
 	}
-	mac := strings.Split(string(macs), "\n")[0]
-	url = url + string(mac) + "/vpc-id"
-	client.Get(url)
+	macs, err := io.ReadAll(macsOut.Content)
 	if err != nil {
-		return
+		return "", "", fmt.Errorf("imds read macs: %w", err)
 	}
-	res, err = client.Get(url)
+	mac := strings.TrimSuffix(strings.Split(string(macs), "\n")[0], "/")
+
+	vpcOut, err := client.GetMetadata(ctx, &imds.GetMetadataInput{Path: "network/interfaces/macs/" + mac + "/vpc-id"})
 	if err != nil {
-		return
+		return "", "", fmt.Errorf("imds get vpc-id: %w", err)
 	}
-	vpcID, err := io.ReadAll(res.Body)
+	vpcID, err := io.ReadAll(vpcOut.Content)
 	if err != nil {
-		return
+		return "", "", fmt.Errorf("imds read vpc-id: %w", err)
 	}
 	vpcid = string(vpcID)
-	// get region from instance meta url
-	url = "http://instance-data/latest/dynamic/instance-identity/document"
-	client = &http.Client{
-		Timeout: time.Second * 5,
-	}
-	res, err = client.Get(url)
-	if err != nil {
-		return
-	}
-	document, err := io.ReadAll(res.Body)
-	if err != nil {
-		return
-	}
-	region = gjson.Get(string(document), "region").String()
 
 	logrus.WithFields(logrus.Fields{
 		"vpcid":  vpcid,
 		"region": region,
 	}).Info("get info from imds")
-	return
+	return vpcid, region, nil
+}
+
+// getInfoFromEnv discovers the VPC and region from environment variables,
+// typically populated via the Kubernetes downward API, for platforms like
+// Fargate where no IMDS endpoint is reachable at all.
+func getInfoFromEnv() (vpcid string, region string, err error) {
+	vpcid = os.Getenv("AWS_VPC_ID")
+	region = os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if vpcid == "" || region == "" {
+		return "", "", fmt.Errorf("AWS_VPC_ID/AWS_REGION not set and imds was unreachable")
+	}
+	logrus.WithFields(logrus.Fields{
+		"vpcid":  vpcid,
+		"region": region,
+	}).Info("get info from environment")
+	return vpcid, region, nil
 }
\ No newline at end of file
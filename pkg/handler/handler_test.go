@@ -0,0 +1,65 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import "testing"
+
+func TestGetInfoFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		vpcID      string
+		region     string
+		defaultReg string
+		wantVPCID  string
+		wantRegion string
+		wantErr    bool
+	}{
+		{
+			name:       "vpc id and region set",
+			vpcID:      "vpc-1234",
+			region:     "us-east-1",
+			wantVPCID:  "vpc-1234",
+			wantRegion: "us-east-1",
+		},
+		{
+			name:       "falls back to AWS_DEFAULT_REGION",
+			vpcID:      "vpc-1234",
+			defaultReg: "eu-west-1",
+			wantVPCID:  "vpc-1234",
+			wantRegion: "eu-west-1",
+		},
+		{
+			name:    "missing vpc id errors",
+			region:  "us-east-1",
+			wantErr: true,
+		},
+		{
+			name:    "empty region errors",
+			vpcID:   "vpc-1234",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_VPC_ID", tt.vpcID)
+			t.Setenv("AWS_REGION", tt.region)
+			t.Setenv("AWS_DEFAULT_REGION", tt.defaultReg)
+
+			vpcid, region, err := getInfoFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("getInfoFromEnv() = (%q, %q), nil; want error", vpcid, region)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getInfoFromEnv() returned error: %v", err)
+			}
+			if vpcid != tt.wantVPCID || region != tt.wantRegion {
+				t.Errorf("getInfoFromEnv() = (%q, %q), want (%q, %q)", vpcid, region, tt.wantVPCID, tt.wantRegion)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionConfig configures client-go leader election so that running
+// multiple Handler replicas stays safe: without it, two replicas watching
+// the same cluster would race to allocate/associate EIPs and add Shield
+// Advanced protections, leaking addresses and double-billing Shield.
+//
+// Fields here are expected to be populated from the --leader-elect,
+// --leader-elect-lease-duration, --leader-elect-renew-deadline and
+// --leader-elect-retry-period flags in the entrypoint, matching the
+// conventions used by other Kubernetes controllers.
+type LeaderElectionConfig struct {
+	Enabled        bool
+	LeaseName      string
+	LeaseNamespace string
+	LeaseDuration  time.Duration
+	RenewDeadline  time.Duration
+	RetryPeriod    time.Duration
+}
+
+// DefaultLeaderElectionConfig returns the conventional Lease name/timings
+// used when the entrypoint does not override them.
+func DefaultLeaderElectionConfig() LeaderElectionConfig {
+	return LeaderElectionConfig{
+		Enabled:        true,
+		LeaseName:      "aws-pod-eip-controller",
+		LeaseNamespace: "kube-system",
+		LeaseDuration:  15 * time.Second,
+		RenewDeadline:  10 * time.Second,
+		RetryPeriod:    2 * time.Second,
+	}
+}
+
+// Run starts the handler and blocks until ctx is cancelled. With leader
+// election disabled it starts processing immediately, matching the old
+// single-replica behavior. With it enabled, shard goroutines are only
+// started once this replica is elected leader (OnStartedLeading) and are
+// drained as soon as it is demoted (OnStoppedLeading), so a standby replica
+// never touches AWS resources a current leader owns.
+func (h *Handler) Run(ctx context.Context, clientset kubernetes.Interface, cfg LeaderElectionConfig, identity string) error {
+	if !cfg.Enabled {
+		h.init()
+		<-ctx.Done()
+		h.drain()
+		return nil
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      cfg.LeaseName,
+			Namespace: cfg.LeaseNamespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	// RunOrDie returns as soon as this replica is demoted (OnStoppedLeading
+	// has already fired by the time it returns). Loop so a demoted replica
+	// goes back to competing for the lease instead of becoming a permanent
+	// standby for the rest of the process lifetime.
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: cfg.LeaseDuration,
+			RenewDeadline: cfg.RenewDeadline,
+			RetryPeriod:   cfg.RetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logrus.WithField("identity", identity).Info("acquired leader lease, starting shard goroutines")
+					h.init()
+				},
+				OnStoppedLeading: func() {
+					logrus.WithField("identity", identity).Warn("lost leader lease, draining in-flight work and re-competing")
+					h.drain()
+				},
+			},
+		})
+	}
+	return nil
+}
+
+// drain shuts down every shard's workqueue and stops its reconciler, then
+// blocks until the process()/reconcile() goroutines have actually exited.
+// Without waiting, OnStartedLeading for a newly-elected replica could start
+// processing the same PodIPs while this replica's goroutines were still
+// mid-flight, racing two replicas' Elastic IP associations against the same
+// pod.
+func (h *Handler) drain() {
+	close(h.stopCh)
+	for _, q := range h.Queues {
+		q.ShutDown()
+	}
+	h.wg.Wait()
+}
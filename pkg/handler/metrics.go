@@ -0,0 +1,149 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultReadinessCheckInterval is how often the readiness server re-checks
+// AWS reachability, rather than trusting the one-time check done at startup
+// for the rest of the process's life.
+const DefaultReadinessCheckInterval = 30 * time.Second
+
+var (
+	eventsProcessedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eip_controller_events_processed_total",
+		Help: "Number of pod events processed, by shard, action and outcome",
+	}, []string{"shard", "action", "outcome"})
+
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "eip_controller_queue_depth",
+		Help: "Current number of items queued for processing, by shard",
+	}, []string{"shard"})
+
+	queueRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eip_controller_queue_retries_total",
+		Help: "Number of times an item was re-queued with backoff after a failed reconcile, by shard",
+	}, []string{"shard"})
+
+	eipAllocationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eip_controller_eip_allocations_total",
+		Help: "Number of Elastic IP allocate/associate/release operations, by action and outcome",
+	}, []string{"action", "outcome"})
+
+	shieldProtectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eip_controller_shield_protections_total",
+		Help: "Number of Shield Advanced protection add/remove operations, by action and outcome",
+	}, []string{"action", "outcome"})
+
+	awsAPILatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "eip_controller_aws_api_latency_seconds",
+		Help:    "Latency of AWS API calls made by the controller, by operation and outcome",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+
+	shardsAliveGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "eip_controller_shards_alive",
+		Help: "Number of shard processing goroutines currently running on this replica",
+	})
+)
+
+// metricsServer owns the HTTP server backing /healthz, /readyz and /metrics.
+type metricsServer struct {
+	server *http.Server
+
+	shardsAlive int32 // atomic count of process() goroutines currently running
+	ready       int32 // atomic bool: EC2 and Shield Advanced clients reachable
+}
+
+func newMetricsServer(addr string) *metricsServer {
+	m := &metricsServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", m.handleHealthz)
+	mux.HandleFunc("/readyz", m.handleReadyz)
+	mux.Handle("/metrics", promhttp.Handler())
+	m.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	return m
+}
+
+func (m *metricsServer) start() {
+	go func() {
+		if err := m.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Error("metrics server stopped unexpectedly")
+		}
+	}()
+}
+
+func (m *metricsServer) stop(ctx context.Context) error {
+	return m.server.Shutdown(ctx)
+}
+
+func (m *metricsServer) markReady(ready bool) {
+	if ready {
+		atomic.StoreInt32(&m.ready, 1)
+	} else {
+		atomic.StoreInt32(&m.ready, 0)
+	}
+}
+
+func (m *metricsServer) shardStarted() {
+	atomic.AddInt32(&m.shardsAlive, 1)
+	shardsAliveGauge.Set(float64(atomic.LoadInt32(&m.shardsAlive)))
+}
+
+func (m *metricsServer) shardStopped() {
+	atomic.AddInt32(&m.shardsAlive, -1)
+	shardsAliveGauge.Set(float64(atomic.LoadInt32(&m.shardsAlive)))
+}
+
+// handleHealthz reports liveness: the HTTP server itself is up and the
+// process is not deadlocked. It deliberately does not depend on shardsAlive
+// or leadership: a standby replica with leader election enabled never starts
+// its shard goroutines, and treating that as unhealthy would crash-loop
+// every non-leader replica forever. Shard activity is exposed separately via
+// the eip_controller_shards_alive metric instead.
+func (m *metricsServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// handleReadyz reports readiness: the most recent periodic check (see
+// Handler.refreshReadiness) of AWS reachability succeeded. Unlike healthz,
+// which always reports ok, this is re-evaluated continuously rather than
+// latched true at startup, so
+// a replica that loses connectivity to AWS after starting stops reporting
+// ready.
+func (m *metricsServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&m.ready) == 0 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// observeAWSCall records the latency of an AWS API call for the histogram
+// above. Callers wrap their service.EC2Service/ShiedService invocations with
+// it, e.g. defer observeAWSCall("associate_address", &err)(time.Now()).
+func observeAWSCall(operation string, err *error) func(time.Time) {
+	return func(start time.Time) {
+		outcome := "success"
+		if err != nil && *err != nil {
+			outcome = "error"
+		}
+		awsAPILatencySeconds.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleHealthzIgnoresShardsAlive(t *testing.T) {
+	m := &metricsServer{}
+
+	// A standby replica under leader election never increments shardsAlive,
+	// since its shard goroutines are never started. healthz must still
+	// report healthy, or every non-leader replica crash-loops forever.
+	rec := httptest.NewRecorder()
+	m.handleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handleHealthz with no shards alive = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	m.shardStarted()
+	rec = httptest.NewRecorder()
+	m.handleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handleHealthz with shards alive = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHandleReadyzReflectsMarkReady(t *testing.T) {
+	m := &metricsServer{}
+
+	rec := httptest.NewRecorder()
+	m.handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("handleReadyz before markReady = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	m.markReady(true)
+	rec = httptest.NewRecorder()
+	m.handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handleReadyz after markReady(true) = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	m.markReady(false)
+	rec = httptest.NewRecorder()
+	m.handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("handleReadyz after markReady(false) = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Rate limiter tuning for the per-shard workqueues. Failed reconciles back
+// off exponentially between these bounds instead of being dropped.
+const (
+	queueBaseDelay = 200 * time.Millisecond
+	queueMaxDelay  = 60 * time.Second
+)
+
+func newShardQueue(shard int) workqueue.RateLimitingInterface {
+	limiter := workqueue.NewItemExponentialFailureRateLimiter(queueBaseDelay, queueMaxDelay)
+	return workqueue.NewNamedRateLimitingQueue(limiter, fmt.Sprintf("eip-controller-shard-%d", shard))
+}
+
+// pendingEvents holds the latest event received for each PodIP in a shard,
+// so that multiple updates queued for the same key before it is processed
+// coalesce into a single reconcile instead of being handled one at a time.
+type pendingEvents struct {
+	mu sync.Mutex
+	m  map[string]event
+}
+
+func newPendingEvents() *pendingEvents {
+	return &pendingEvents{m: make(map[string]event)}
+}
+
+func (p *pendingEvents) set(podIP string, e event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.m[podIP] = e
+}
+
+func (p *pendingEvents) get(podIP string) (event, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.m[podIP]
+	return e, ok
+}
+
+// deleteIfSame removes podIP's entry only if it still matches the event
+// just finished processing. A newer event can land in the map (via set)
+// while the one we fetched earlier is being processed; blindly deleting
+// would wipe that newer event out from under its own coalesced redelivery,
+// and it would never be retried. Returns whether anything was deleted.
+func (p *pendingEvents) deleteIfSame(podIP string, e event) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if current, ok := p.m[podIP]; !ok || current.ResourceVersion != e.ResourceVersion {
+		return false
+	}
+	delete(p.m, podIP)
+	return true
+}
@@ -0,0 +1,48 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import "testing"
+
+func TestPendingEventsDeleteIfSameDeletesMatchingEntry(t *testing.T) {
+	p := newPendingEvents()
+	e := event{PodIP: "10.0.0.5", ResourceVersion: "1"}
+	p.set(e.PodIP, e)
+
+	if deleted := p.deleteIfSame(e.PodIP, e); !deleted {
+		t.Fatal("deleteIfSame = false, want true for a matching entry")
+	}
+	if _, ok := p.get(e.PodIP); ok {
+		t.Fatal("entry still present after deleteIfSame reported success")
+	}
+}
+
+func TestPendingEventsDeleteIfSameKeepsNewerEntry(t *testing.T) {
+	p := newPendingEvents()
+	stale := event{PodIP: "10.0.0.5", ResourceVersion: "1"}
+	fresh := event{PodIP: "10.0.0.5", ResourceVersion: "2"}
+	p.set(stale.PodIP, stale)
+
+	// Simulate a newer event coalescing in while the stale one is still
+	// being processed.
+	p.set(fresh.PodIP, fresh)
+
+	if deleted := p.deleteIfSame(stale.PodIP, stale); deleted {
+		t.Fatal("deleteIfSame = true, want false: it deleted a newer coalesced event")
+	}
+	got, ok := p.get(fresh.PodIP)
+	if !ok {
+		t.Fatal("fresh entry was removed even though deleteIfSame was called with the stale event")
+	}
+	if got.ResourceVersion != fresh.ResourceVersion {
+		t.Errorf("pending entry ResourceVersion = %q, want %q", got.ResourceVersion, fresh.ResourceVersion)
+	}
+}
+
+func TestPendingEventsDeleteIfSameNoEntry(t *testing.T) {
+	p := newPendingEvents()
+	if deleted := p.deleteIfSame("10.0.0.5", event{PodIP: "10.0.0.5", ResourceVersion: "1"}); deleted {
+		t.Fatal("deleteIfSame = true, want false: there was nothing to delete")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package handler
+
+import (
+	"time"
+
+	"github.com/aws-samples/aws-pod-eip-controller/pkg/service"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultReconcileInterval is how often each shard's reconciler compares the
+// EIPs it finds tagged in the VPC against the pods it currently knows about.
+const DefaultReconcileInterval = 5 * time.Minute
+
+// reconcile periodically lists the Elastic IPs this controller has tagged in
+// the VPC and reconciles them against the shard's cache, releasing addresses
+// whose PodIP is neither tracked nor still assigned to any ENI (the pod was
+// deleted, but the delete event was missed) and re-associating addresses for
+// tracked pods that have no tagged address. This mirrors the reflector+reconcile pattern used by
+// mature Kubernetes controllers and closes the leak where a missed delete
+// event permanently orphans a billed Elastic IP.
+func (h *Handler) reconcile(i int) {
+	interval := h.ReconcileInterval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.reconcileOnce(i)
+		case <-h.stopCh:
+			return
+		}
+	}
+}
+
+func (h *Handler) reconcileOnce(i int) {
+	tagged, err := h.EC2Service.ListControllerTaggedAddresses()
+	if err != nil {
+		logrus.WithError(err).WithField("shard", i).Error("reconcile: list tagged addresses")
+		return
+	}
+
+	taggedByPodIP := make(map[string]struct{}, len(tagged))
+	for _, addr := range tagged {
+		if addr.PodIP != "" {
+			taggedByPodIP[addr.PodIP] = struct{}{}
+		}
+	}
+
+	trackedPodIPs := h.EipStatusMap[i].keys()
+	tracked := make(map[string]struct{}, len(trackedPodIPs))
+	for _, podIP := range trackedPodIPs {
+		tracked[podIP] = struct{}{}
+	}
+
+	h.releaseOrphanedAddresses(i, tagged, tracked)
+	h.reassociateMissingAddresses(i, trackedPodIPs, taggedByPodIP)
+}
+
+// releaseOrphanedAddresses releases Elastic IPs that are tagged as
+// controller-managed in this shard but no longer correspond to a live pod.
+// tracked (the shard's cache keys) is only used to skip the extra AWS call
+// for pods we've recently heard from; a PodIP missing from tracked still
+// gets a live check against the pod's ENI before release, because tracked
+// can be empty or stale for reasons that have nothing to do with whether the
+// pod is actually gone (TTL eviction, a fresh cache after re-init).
+func (h *Handler) releaseOrphanedAddresses(i int, tagged []service.TaggedAddress, tracked map[string]struct{}) {
+	for _, addr := range tagged {
+		if hashPodIP(addr.PodIP)%uint64(h.ChannelSize) != uint64(i) {
+			continue
+		}
+		if _, ok := tracked[addr.PodIP]; ok {
+			continue
+		}
+		hasENI, err := h.EC2Service.PodIPHasNetworkInterface(addr.PodIP)
+		if err != nil {
+			logrus.WithError(err).WithField("pod_ip", addr.PodIP).Error("reconcile: check pod ENI before release")
+			continue
+		}
+		if hasENI {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"shard":         i,
+			"pod_ip":        addr.PodIP,
+			"allocation_id": addr.AllocationID,
+		}).Warn("reconcile: releasing orphaned Elastic IP with no known pod")
+		if err := h.EC2Service.ReleaseAddress(addr.AllocationID); err != nil {
+			logrus.WithError(err).WithField("allocation_id", addr.AllocationID).Error("reconcile: release orphaned address")
+			eipAllocationsTotal.WithLabelValues("release", "error").Inc()
+			continue
+		}
+		eipAllocationsTotal.WithLabelValues("release", "success").Inc()
+	}
+}
+
+// reassociateMissingAddresses re-runs event.Process for tracked pods that
+// expect an attached Elastic IP (AttachIP) but have no tagged address in
+// AWS, e.g. because a prior association attempt failed after the event was
+// marked processed, or the address was released out-of-band. taggedByPodIP
+// only ever contains IPv4 allocations (BYOIP IPv6 addresses are assigned
+// straight onto an ENI, with no Elastic IP to tag), so family "ipv6" pods
+// are skipped here rather than treated as missing on every tick.
+func (h *Handler) reassociateMissingAddresses(i int, trackedPodIPs []string, taggedByPodIP map[string]struct{}) {
+	for _, podIP := range trackedPodIPs {
+		e, ok := h.EipStatusMap[i].get(podIP)
+		if !ok || !e.AttachIP || e.Family == "ipv6" {
+			continue
+		}
+		if _, ok := taggedByPodIP[podIP]; ok {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"shard":  i,
+			"pod_ip": podIP,
+		}).Warn("reconcile: re-associating Elastic IP for tracked pod with no tagged address")
+		if err := e.Process(nil, h.EC2Service, h.ShiedService); err != nil {
+			logrus.WithError(err).WithField("pod_ip", podIP).Error("reconcile: re-associate address")
+			eipAllocationsTotal.WithLabelValues("reassociate", "error").Inc()
+			continue
+		}
+		eipAllocationsTotal.WithLabelValues("reassociate", "success").Inc()
+	}
+}
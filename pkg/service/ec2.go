@@ -0,0 +1,302 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// controllerTagKey marks Elastic IPs this controller owns, so the
+// reconciler can tell its own allocations apart from unrelated EIPs in the
+// VPC when listing addresses to reconcile.
+const controllerTagKey = "aws-pod-eip-controller/managed"
+
+// EC2Service wraps the EC2 API calls the controller needs to allocate,
+// associate and release Elastic IPs for pods, including BYOIP IPv6
+// addresses associated onto a pod's ENI.
+type EC2Service struct {
+	client *ec2.Client
+	vpcID  string
+}
+
+func NewEC2Service(vpcid string, region string) (*EC2Service, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+	return &EC2Service{
+		client: ec2.NewFromConfig(cfg),
+		vpcID:  vpcid,
+	}, nil
+}
+
+// TaggedAddress is an Elastic IP this controller has tagged as belonging to
+// a pod, as returned by ListControllerTaggedAddresses.
+type TaggedAddress struct {
+	AllocationID string
+	PodIP        string
+}
+
+// ListControllerTaggedAddresses lists the Elastic IPs in the VPC carrying
+// this controller's management tag, for the reconciler to compare against
+// the pods it currently knows about.
+func (s *EC2Service) ListControllerTaggedAddresses() ([]TaggedAddress, error) {
+	out, err := s.client.DescribeAddresses(context.Background(), &ec2.DescribeAddressesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("tag-key"),
+			Values: []string{controllerTagKey},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe addresses: %w", err)
+	}
+	addresses := make([]TaggedAddress, 0, len(out.Addresses))
+	for _, addr := range out.Addresses {
+		podIP := ""
+		for _, tag := range addr.Tags {
+			if aws.ToString(tag.Key) == controllerTagKey {
+				podIP = aws.ToString(tag.Value)
+			}
+		}
+		addresses = append(addresses, TaggedAddress{
+			AllocationID: aws.ToString(addr.AllocationId),
+			PodIP:        podIP,
+		})
+	}
+	return addresses, nil
+}
+
+// ReleaseAddress releases an Elastic IP that no longer has a live pod
+// behind it.
+func (s *EC2Service) ReleaseAddress(allocationID string) error {
+	_, err := s.client.ReleaseAddress(context.Background(), &ec2.ReleaseAddressInput{
+		AllocationId: aws.String(allocationID),
+	})
+	return err
+}
+
+// ReleaseAddressForPod releases the Elastic IP tagged as belonging to
+// podIP, if one exists. It is a no-op if no tagged address is found, since
+// that means there is nothing left to release.
+func (s *EC2Service) ReleaseAddressForPod(podIP string) error {
+	tagged, err := s.ListControllerTaggedAddresses()
+	if err != nil {
+		return err
+	}
+	for _, addr := range tagged {
+		if addr.PodIP == podIP {
+			return s.ReleaseAddress(addr.AllocationID)
+		}
+	}
+	return nil
+}
+
+// AllocateAndAssociate associates an IPv4 Elastic IP tagged with podIP with
+// the ENI that already carries podIP as a secondary private address,
+// allocating a new one only if this controller doesn't already have one
+// tagged for podIP. Without that check, a retry after a failed association
+// (the allocation having already succeeded on an earlier attempt) would
+// allocate and orphan one more Elastic IP every time, since the cache entry
+// that would normally suppress the re-allocation is never written on a
+// failed attempt. It returns the allocation ID so callers that also need to
+// Shield-protect the address (see ShiedService.AddProtection) don't have to
+// look it back up.
+func (s *EC2Service) AllocateAndAssociate(podIP string) (string, error) {
+	tagged, err := s.ListControllerTaggedAddresses()
+	if err != nil {
+		return "", fmt.Errorf("list tagged addresses for pod ip %s: %w", podIP, err)
+	}
+	allocationID := ""
+	for _, addr := range tagged {
+		if addr.PodIP == podIP {
+			allocationID = addr.AllocationID
+			break
+		}
+	}
+
+	if allocationID == "" {
+		allocOut, err := s.client.AllocateAddress(context.Background(), &ec2.AllocateAddressInput{
+			Domain: types.DomainTypeVpc,
+			TagSpecifications: []types.TagSpecification{{
+				ResourceType: types.ResourceTypeElasticIp,
+				Tags:         []types.Tag{{Key: aws.String(controllerTagKey), Value: aws.String(podIP)}},
+			}},
+		})
+		if err != nil {
+			return "", fmt.Errorf("allocate address: %w", err)
+		}
+		allocationID = aws.ToString(allocOut.AllocationId)
+	}
+
+	eniOut, err := s.client.DescribeNetworkInterfaces(context.Background(), &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("addresses.private-ip-address"),
+			Values: []string{podIP},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("find network interface for pod ip %s: %w", podIP, err)
+	}
+	if len(eniOut.NetworkInterfaces) == 0 {
+		return "", fmt.Errorf("find network interface for pod ip %s: no matching ENI", podIP)
+	}
+
+	_, err = s.client.AssociateAddress(context.Background(), &ec2.AssociateAddressInput{
+		AllocationId:       aws.String(allocationID),
+		NetworkInterfaceId: eniOut.NetworkInterfaces[0].NetworkInterfaceId,
+		PrivateIpAddress:   aws.String(podIP),
+	})
+	if err != nil {
+		return "", fmt.Errorf("associate address with pod ip %s: %w", podIP, err)
+	}
+	return allocationID, nil
+}
+
+// PodIPHasNetworkInterface reports whether podIP is still assigned to an ENI
+// in the VPC. The reconciler uses this as the source of truth for whether a
+// pod is still alive before releasing its Elastic IP, rather than trusting a
+// local cache whose entries can age out on their own TTL independent of
+// whether the pod itself is still running.
+func (s *EC2Service) PodIPHasNetworkInterface(podIP string) (bool, error) {
+	out, err := s.client.DescribeNetworkInterfaces(context.Background(), &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("addresses.private-ip-address"),
+			Values: []string{podIP},
+		}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("find network interface for pod ip %s: %w", podIP, err)
+	}
+	return len(out.NetworkInterfaces) > 0, nil
+}
+
+// Ping performs a lightweight, read-only EC2 call so callers can verify the
+// client is actually able to reach the EC2 API and is authorized for this
+// VPC, rather than just having been constructed successfully.
+func (s *EC2Service) Ping() error {
+	_, err := s.client.DescribeVpcs(context.Background(), &ec2.DescribeVpcsInput{VpcIds: []string{s.vpcID}})
+	if err != nil {
+		return fmt.Errorf("describe vpc %s: %w", s.vpcID, err)
+	}
+	return nil
+}
+
+// networkInterface is the subset of an instance's ENIs AssociateIPv6 needs
+// to pick the right one for a pod IP. SubnetCIDRs holds every CIDR block
+// associated with the ENI's subnet — the subnet's single IPv4 CidrBlock
+// plus one entry per associated IPv6 CIDR — since an IPv6 pod IP will never
+// be contained by the subnet's IPv4 range.
+type networkInterface struct {
+	NetworkInterfaceID string
+	SubnetCIDRs        []string
+}
+
+// selectENIForPodIP picks the ENI on the instance whose subnet contains
+// podIP, rather than always assuming ENI 0 — an instance with multiple ENIs
+// (e.g. a secondary ENI dedicated to pod networking) otherwise gets the
+// association attached to the wrong interface. It checks every CIDR on the
+// ENI's subnet so it works for both the subnet's IPv4 range and any of its
+// associated IPv6 ranges.
+func selectENIForPodIP(enis []networkInterface, podIP string) (networkInterface, error) {
+	ip := net.ParseIP(podIP)
+	if ip == nil {
+		return networkInterface{}, fmt.Errorf("invalid pod IP %q", podIP)
+	}
+	for _, eni := range enis {
+		for _, subnetCIDR := range eni.SubnetCIDRs {
+			_, cidr, err := net.ParseCIDR(subnetCIDR)
+			if err != nil {
+				continue
+			}
+			if cidr.Contains(ip) {
+				return eni, nil
+			}
+		}
+	}
+	return networkInterface{}, fmt.Errorf("no ENI subnet contains pod IP %s", podIP)
+}
+
+// AssociateIPv6 associates a BYOIP IPv6 address with the pod's IPv6 address
+// on the correct secondary ENI, selected by matching the pod IP against
+// each ENI's subnet CIDR instead of always using the instance's primary
+// (ENI 0) interface.
+func (s *EC2Service) AssociateIPv6(instanceID, podIPv6 string) error {
+	out, err := s.client.DescribeNetworkInterfaces(context.Background(), &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("attachment.instance-id"),
+			Values: []string{instanceID},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("describe network interfaces: %w", err)
+	}
+	return s.assignIpv6ToMatchingENI(out.NetworkInterfaces, podIPv6)
+}
+
+// AssociateIPv6ForPod is like AssociateIPv6 but doesn't require knowing the
+// pod's node instance ID up front: it scans every ENI in the VPC for one
+// whose subnet contains podIPv6. Used by event.Process, which only has the
+// pod IP to work with.
+func (s *EC2Service) AssociateIPv6ForPod(podIPv6 string) error {
+	out, err := s.client.DescribeNetworkInterfaces(context.Background(), &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("vpc-id"),
+			Values: []string{s.vpcID},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("describe network interfaces: %w", err)
+	}
+	return s.assignIpv6ToMatchingENI(out.NetworkInterfaces, podIPv6)
+}
+
+func (s *EC2Service) assignIpv6ToMatchingENI(networkInterfaces []types.NetworkInterface, podIPv6 string) error {
+	enis := make([]networkInterface, 0, len(networkInterfaces))
+	for _, ni := range networkInterfaces {
+		if ni.SubnetId == nil {
+			continue
+		}
+		subnetOut, err := s.client.DescribeSubnets(context.Background(), &ec2.DescribeSubnetsInput{
+			SubnetIds: []string{aws.ToString(ni.SubnetId)},
+		})
+		if err != nil || len(subnetOut.Subnets) == 0 {
+			continue
+		}
+		subnet := subnetOut.Subnets[0]
+		cidrs := make([]string, 0, 1+len(subnet.Ipv6CidrBlockAssociationSet))
+		if subnet.CidrBlock != nil {
+			cidrs = append(cidrs, aws.ToString(subnet.CidrBlock))
+		}
+		for _, assoc := range subnet.Ipv6CidrBlockAssociationSet {
+			if assoc.Ipv6CidrBlock != nil {
+				cidrs = append(cidrs, aws.ToString(assoc.Ipv6CidrBlock))
+			}
+		}
+		enis = append(enis, networkInterface{
+			NetworkInterfaceID: aws.ToString(ni.NetworkInterfaceId),
+			SubnetCIDRs:        cidrs,
+		})
+	}
+
+	eni, err := selectENIForPodIP(enis, podIPv6)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.AssignIpv6Addresses(context.Background(), &ec2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String(eni.NetworkInterfaceID),
+		Ipv6Addresses:      []string{podIPv6},
+	})
+	if err != nil {
+		return fmt.Errorf("assign ipv6 address: %w", err)
+	}
+	return nil
+}
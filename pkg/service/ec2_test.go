@@ -0,0 +1,73 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package service
+
+import "testing"
+
+func TestSelectENIForPodIP(t *testing.T) {
+	enis := []networkInterface{
+		{NetworkInterfaceID: "eni-primary", SubnetCIDRs: []string{"10.0.0.0/24"}},
+		{NetworkInterfaceID: "eni-pods", SubnetCIDRs: []string{"10.0.1.0/24"}},
+	}
+
+	got, err := selectENIForPodIP(enis, "10.0.1.42")
+	if err != nil {
+		t.Fatalf("selectENIForPodIP returned error: %v", err)
+	}
+	if got.NetworkInterfaceID != "eni-pods" {
+		t.Errorf("selectENIForPodIP = %q, want eni-pods", got.NetworkInterfaceID)
+	}
+}
+
+func TestSelectENIForPodIPNoMatch(t *testing.T) {
+	enis := []networkInterface{
+		{NetworkInterfaceID: "eni-primary", SubnetCIDRs: []string{"10.0.0.0/24"}},
+	}
+	if _, err := selectENIForPodIP(enis, "192.168.1.1"); err == nil {
+		t.Fatal("selectENIForPodIP with no containing subnet: want error, got nil")
+	}
+}
+
+func TestSelectENIForPodIPInvalidIP(t *testing.T) {
+	enis := []networkInterface{
+		{NetworkInterfaceID: "eni-primary", SubnetCIDRs: []string{"10.0.0.0/24"}},
+	}
+	if _, err := selectENIForPodIP(enis, "not-an-ip"); err == nil {
+		t.Fatal("selectENIForPodIP with an invalid pod IP: want error, got nil")
+	}
+}
+
+func TestSelectENIForPodIPSkipsMalformedCIDR(t *testing.T) {
+	enis := []networkInterface{
+		{NetworkInterfaceID: "eni-bad", SubnetCIDRs: []string{"not-a-cidr"}},
+		{NetworkInterfaceID: "eni-good", SubnetCIDRs: []string{"10.0.0.0/24"}},
+	}
+	got, err := selectENIForPodIP(enis, "10.0.0.5")
+	if err != nil {
+		t.Fatalf("selectENIForPodIP returned error: %v", err)
+	}
+	if got.NetworkInterfaceID != "eni-good" {
+		t.Errorf("selectENIForPodIP = %q, want eni-good", got.NetworkInterfaceID)
+	}
+}
+
+// TestSelectENIForPodIPMatchesIpv6AssociatedCIDR exercises the real call
+// shape the IPv6 BYOIP association path relies on: each ENI's subnet
+// carries its IPv4 CidrBlock alongside one or more IPv6 CIDRs from
+// Ipv6CidrBlockAssociationSet, and an IPv6 pod IP only ever matches the
+// latter.
+func TestSelectENIForPodIPMatchesIpv6AssociatedCIDR(t *testing.T) {
+	enis := []networkInterface{
+		{NetworkInterfaceID: "eni-primary", SubnetCIDRs: []string{"10.0.0.0/24", "2001:db8:1::/64"}},
+		{NetworkInterfaceID: "eni-pods", SubnetCIDRs: []string{"10.0.1.0/24", "2001:db8:2::/64"}},
+	}
+
+	got, err := selectENIForPodIP(enis, "2001:db8:2::42")
+	if err != nil {
+		t.Fatalf("selectENIForPodIP returned error: %v", err)
+	}
+	if got.NetworkInterfaceID != "eni-pods" {
+		t.Errorf("selectENIForPodIP = %q, want eni-pods", got.NetworkInterfaceID)
+	}
+}